@@ -0,0 +1,15 @@
+package lzo
+
+// BlockInfo describes one lzop block, the unit OnBlock callbacks on
+// Indexer and ParallelReader report progress in, inspired by
+// pierrec/lz4.Reader's OnBlockDone hook. CreateIndex also returns the
+// full block list as []BlockInfo so callers that want both the on-disk
+// .index and an in-memory table don't have to re-scan the file.
+type BlockInfo struct {
+	Index           int
+	FileOffset      int64
+	CompressedLen   uint32
+	UncompressedLen uint32
+	AdlerD          uint32
+	CRCD            uint32
+}
@@ -0,0 +1,147 @@
+package lzo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+	"time"
+)
+
+// readLzopHeader parses an lzop stream header from r and verifies its
+// checksum using adler and crc, which the caller must have wired up (via
+// io.TeeReader or similar) to observe every header byte as it is read.
+// It is shared by every reader type in this package (Indexer,
+// ParallelReader, IndexedReader) so the header format only has to be taught to the code
+// once.
+func readLzopHeader(r io.Reader, adler, crc hash.Hash32) (IndexHeader, error) {
+	var hdr IndexHeader
+	var buf [512]byte
+
+	read := func(data interface{}) error {
+		return binary.Read(r, binary.BigEndian, data)
+	}
+
+	// Read and check magic
+	if _, err := io.ReadFull(r, buf[0:len(lzoMagic)]); err != nil {
+		return hdr, err
+	}
+	if !bytes.Equal(buf[0:len(lzoMagic)], lzoMagic) {
+		return hdr, errors.New("lzo: invalid header")
+	}
+	crc.Reset()
+	adler.Reset()
+	// Read version
+	if err := read(&hdr.version); err != nil {
+		return hdr, err
+	}
+	if hdr.version < 0x0900 {
+		return hdr, errors.New("lzo: invalid header")
+	}
+	// Read library version needed to extract
+	if err := read(&hdr.libraryVersion); err != nil {
+		return hdr, err
+	}
+	if hdr.version >= 0x0940 {
+		if err := read(&hdr.libraryVersion); err != nil {
+			return hdr, err
+		}
+		if hdr.libraryVersion > hdr.version {
+			return hdr, errors.New("lzo: incompatible version")
+		}
+		if hdr.libraryVersion < 0x0900 {
+			return hdr, errors.New("lzo: invalid header")
+		}
+	}
+	// Read method
+	if err := read(&hdr.method); err != nil {
+		return hdr, err
+	}
+	// Read level
+	if hdr.version >= 0x0940 {
+		var level uint8
+		if err := read(&level); err != nil {
+			return hdr, err
+		}
+	}
+	// Read flags
+	if err := read(&hdr.flags); err != nil {
+		return hdr, err
+	}
+	// Read filter id, if any. The filter itself (see RegisterFilter) is
+	// applied to each block's decompressed payload by the callers that
+	// decompress blocks, not here.
+	if hdr.flags&flagFilter != 0 {
+		if err := read(&hdr.filterID); err != nil {
+			return hdr, err
+		}
+		hdr.hasFilter = true
+	}
+	// num_compressed_checksums
+	hdr.num_compressed_checksums = 0
+	if hdr.flags&flagAdler32C != 0 {
+		hdr.num_compressed_checksums += 1
+	}
+	if hdr.flags&flagCRC32C != 0 {
+		hdr.num_compressed_checksums += 1
+	}
+	// num_decompressed_checksums
+	hdr.num_decompressed_checksums = 0
+	if hdr.flags&flagAdler32D != 0 {
+		hdr.num_decompressed_checksums += 1
+	}
+	if hdr.flags&flagCRC32D != 0 {
+		hdr.num_decompressed_checksums += 1
+	}
+	// Read mode
+	var mode uint32
+	if err := read(&mode); err != nil {
+		return hdr, err
+	}
+	// Read modification times
+	var modTime, modTimeHigh uint32
+	if err := read(&modTime); err != nil {
+		return hdr, err
+	}
+	hdr.ModTime = time.Unix(int64(modTime), 0)
+	if hdr.version >= 0x0940 {
+		if err := read(&modTimeHigh); err != nil {
+			return hdr, err
+		}
+	}
+	if hdr.version < 0x0120 {
+		hdr.ModTime = time.Unix(0, 0)
+	}
+	// Read name
+	var l uint8
+	if err := read(&l); err != nil {
+		return hdr, err
+	}
+	if l > 0 {
+		if _, err := io.ReadFull(r, buf[0:l]); err != nil {
+			return hdr, err
+		}
+		hdr.Name = string(buf[0:l])
+	}
+	// Read and check header checksum
+	var checksum uint32
+	if hdr.flags&flagCRC32 != 0 {
+		checksum = crc.Sum32()
+		crc.Reset()
+	} else {
+		checksum = adler.Sum32()
+		adler.Reset()
+	}
+	var checksumHeader uint32
+	if err := read(&checksumHeader); err != nil {
+		return hdr, err
+	}
+	if checksumHeader != checksum {
+		return hdr, errors.New("lzo: invalid header")
+	}
+	if hdr.method <= 0 {
+		return hdr, errors.New("lzo: incompatible method")
+	}
+	return hdr, nil
+}
@@ -0,0 +1,212 @@
+package lzo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/adler32"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// indexMagic identifies the brief self-describing .index layout this
+// package wrote before switching to the Hadoop-compatible layout (see
+// IndexWriter). It is only checked on read, so indexes from that window
+// still load correctly.
+var indexMagic = [8]byte{'L', 'Z', 'O', 'I', 'D', 'X', 0, 0}
+
+const indexVersion uint16 = 2
+
+const indexRecordSize = 16 // two big-endian uint64s
+
+// indexRecord pairs a block's start offset in the lzop file with the
+// cumulative number of decompressed bytes through the end of that block,
+// letting a seek target be resolved to a block with a binary search.
+type indexRecord struct {
+	blockStart         int64
+	uncompressedOffset int64
+}
+
+// loadIndex reads indexPath and returns the cumulative-offset table
+// IndexedReader needs to seek. The primary on-disk layout is the
+// Hadoop-compatible bare stream of block-start offsets IndexWriter
+// produces, which carries no cumulative offsets, so those are rebuilt by
+// reading each block's 4-byte dstLen directly off lzoPath - cheap, since
+// no block is ever decompressed just to build the table.
+func loadIndex(indexPath, lzoPath string) ([]indexRecord, error) {
+	data, err := ioutil.ReadFile(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) >= 8 && bytes.Equal(data[:8], indexMagic[:]) {
+		return parseIndexRecords(data[8:])
+	}
+	return blockStartsToRecords(data, lzoPath)
+}
+
+// parseIndexRecords decodes the version and records that follow the magic
+// in the old self-describing .index format.
+func parseIndexRecords(data []byte) ([]indexRecord, error) {
+	if len(data) < 2 {
+		return nil, errors.New("lzo: truncated index file")
+	}
+	ver := binary.BigEndian.Uint16(data[:2])
+	if ver != indexVersion {
+		return nil, errors.New("lzo: unsupported index version")
+	}
+	data = data[2:]
+	if len(data)%indexRecordSize != 0 {
+		return nil, errors.New("lzo: truncated index file")
+	}
+	records := make([]indexRecord, len(data)/indexRecordSize)
+	for i := range records {
+		rec := data[i*indexRecordSize : (i+1)*indexRecordSize]
+		records[i] = indexRecord{
+			blockStart:         int64(binary.BigEndian.Uint64(rec[0:8])),
+			uncompressedOffset: int64(binary.BigEndian.Uint64(rec[8:16])),
+		}
+	}
+	return records, nil
+}
+
+// blockStartsToRecords turns a Hadoop-compatible .index file - a bare
+// stream of big-endian int64 block-start offsets - into the
+// cumulative-offset table IndexedReader seeks against.
+func blockStartsToRecords(data []byte, lzoPath string) ([]indexRecord, error) {
+	if len(data)%8 != 0 {
+		return nil, errors.New("lzo: invalid index file")
+	}
+	f, err := os.Open(lzoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records := make([]indexRecord, 0, len(data)/8)
+	var cumulative int64
+	for i := 0; i+8 <= len(data); i += 8 {
+		blockStart := int64(binary.BigEndian.Uint64(data[i : i+8]))
+		if _, err := f.Seek(blockStart, os.SEEK_SET); err != nil {
+			return nil, err
+		}
+		var dstLen uint32
+		if err := binary.Read(f, binary.BigEndian, &dstLen); err != nil {
+			return nil, err
+		}
+		cumulative += int64(dstLen)
+		records = append(records, indexRecord{blockStart: blockStart, uncompressedOffset: cumulative})
+	}
+	return records, nil
+}
+
+// IndexedReader is an io.ReadSeeker over an lzop file that uses its
+// .index sidecar to seek to any decompressed byte offset without
+// decompressing the blocks that precede it.
+type IndexedReader struct {
+	IndexHeader
+	f       *os.File
+	records []indexRecord
+	pos     int64
+	cur     []byte
+}
+
+// OpenIndexed opens lzoPath and reads its "<lzoPath>.index" sidecar, in
+// either the Hadoop-compatible layout IndexWriter produces or the older
+// self-describing one, and returns an IndexedReader ready to be read or
+// seeked over the decompressed stream. The sidecar itself is not
+// rewritten.
+func OpenIndexed(lzoPath string) (*IndexedReader, error) {
+	records, err := loadIndex(lzoPath+".index", lzoPath)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(lzoPath)
+	if err != nil {
+		return nil, err
+	}
+	adler, crc := adler32.New(), crc32.NewIEEE()
+	hdr, err := readLzopHeader(io.TeeReader(f, io.MultiWriter(adler, crc)), adler, crc)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &IndexedReader{IndexHeader: hdr, f: f, records: records}, nil
+}
+
+// Len returns the total number of decompressed bytes in the stream, taken
+// from the cumulative offset recorded for the last block.
+func (r *IndexedReader) Len() int64 {
+	if len(r.records) == 0 {
+		return 0
+	}
+	return r.records[len(r.records)-1].uncompressedOffset
+}
+
+// Seek implements io.Seeker over decompressed offsets: it binary-searches
+// the index for the block containing offset, decompresses just that
+// block, and discards the in-block prefix before offset.
+func (r *IndexedReader) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = r.pos + offset
+	case io.SeekEnd:
+		target = r.Len() + offset
+	default:
+		return 0, errors.New("lzo: invalid whence")
+	}
+	if target < 0 || target > r.Len() {
+		return 0, errors.New("lzo: seek out of range")
+	}
+
+	i := sort.Search(len(r.records), func(i int) bool {
+		return r.records[i].uncompressedOffset > target
+	})
+	if i == len(r.records) {
+		r.cur = nil
+		r.pos = target
+		return target, nil
+	}
+
+	data, err := readBlockAt(r.f, r.IndexHeader, r.records[i].blockStart)
+	if err != nil {
+		return 0, err
+	}
+	var prevCumulative int64
+	if i > 0 {
+		prevCumulative = r.records[i-1].uncompressedOffset
+	}
+	r.cur = data[target-prevCumulative:]
+	r.pos = target
+	return target, nil
+}
+
+// Read implements io.Reader over the decompressed stream, fetching and
+// decompressing one block at a time as needed.
+func (r *IndexedReader) Read(p []byte) (int, error) {
+	if len(r.cur) == 0 {
+		if r.pos >= r.Len() {
+			return 0, io.EOF
+		}
+		if _, err := r.Seek(r.pos, io.SeekStart); err != nil {
+			return 0, err
+		}
+		if len(r.cur) == 0 {
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, r.cur)
+	r.cur = r.cur[n:]
+	r.pos += int64(n)
+	return n, nil
+}
+
+// Close closes the underlying lzop file.
+func (r *IndexedReader) Close() error {
+	return r.f.Close()
+}
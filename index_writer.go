@@ -0,0 +1,105 @@
+package lzo
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// IndexWriter writes an lzop .index sidecar in the format
+// com.hadoop.compression.lzo.LzoIndex expects: a bare stream of
+// big-endian int64 values, each the compressed-file offset where a block
+// begins. Because it only needs an io.Writer, callers can point it at an
+// HDFS or S3 client instead of a local file.
+type IndexWriter struct {
+	w io.Writer
+}
+
+// NewIndexWriter returns an IndexWriter that appends block-start offsets
+// to w as CreateIndex (or a caller walking its own stream) reports them.
+func NewIndexWriter(w io.Writer) *IndexWriter {
+	return &IndexWriter{w: w}
+}
+
+// WriteBlockStart records the compressed-file offset of a block.
+func (iw *IndexWriter) WriteBlockStart(offset int64) error {
+	return binary.Write(iw.w, binary.BigEndian, uint64(offset))
+}
+
+// Index is the decoded contents of an lzop file's .index sidecar: the
+// compressed-stream offsets where each block begins, plus the size of
+// the lzop file itself so splits can be closed off at EOF.
+type Index struct {
+	Starts   []int64
+	fileSize int64
+}
+
+// ReadIndex loads the block-start offsets recorded in "<lzoPath>.index".
+func ReadIndex(lzoPath string) (*Index, error) {
+	data, err := ioutil.ReadFile(lzoPath + ".index")
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%8 != 0 {
+		return nil, errors.New("lzo: invalid index file")
+	}
+	starts := make([]int64, len(data)/8)
+	for i := range starts {
+		starts[i] = int64(binary.BigEndian.Uint64(data[i*8 : i*8+8]))
+	}
+	fi, err := os.Stat(lzoPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Index{Starts: starts, fileSize: fi.Size()}, nil
+}
+
+// SplitIterator walks idx in splitSize-sized chunks, snapping each
+// boundary forward to the next recorded block start - the same algorithm
+// Hadoop's LzoIndex uses to turn an arbitrary split size into ranges that
+// never cut an LZO block in half. splitSize must be positive, or Next
+// would never advance past its first split.
+func (idx *Index) SplitIterator(splitSize int64) (*SplitIterator, error) {
+	if splitSize <= 0 {
+		return nil, errors.New("lzo: splitSize must be positive")
+	}
+	return &SplitIterator{idx: idx, splitSize: splitSize}, nil
+}
+
+// SplitIterator yields (startOffset, endOffset) pairs aligned to block
+// boundaries. Call Next until ok is false.
+type SplitIterator struct {
+	idx       *Index
+	splitSize int64
+	pos       int64
+	done      bool
+}
+
+// Next returns the next aligned split range, or ok == false once the
+// whole file has been covered.
+func (s *SplitIterator) Next() (start, end int64, ok bool) {
+	if s.done {
+		return 0, 0, false
+	}
+	start = s.pos
+	target := start + s.splitSize
+	if target >= s.idx.fileSize {
+		s.done = true
+		return start, s.idx.fileSize, true
+	}
+	i := sort.Search(len(s.idx.Starts), func(i int) bool {
+		return s.idx.Starts[i] >= target
+	})
+	end = s.idx.fileSize
+	if i < len(s.idx.Starts) {
+		end = s.idx.Starts[i]
+	}
+	if end >= s.idx.fileSize {
+		s.done = true
+	}
+	s.pos = end
+	return start, end, true
+}
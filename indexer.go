@@ -1,10 +1,8 @@
 package lzo
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
-	"fmt"
 	"hash"
 	"hash/adler32"
 	"hash/crc32"
@@ -61,6 +59,8 @@ type IndexHeader struct {
 	method                     uint8
 	num_compressed_checksums   uint
 	num_decompressed_checksums uint
+	filterID                   uint32
+	hasFilter                  bool
 }
 
 // A Reader is an io.Reader that can be read to retrieve
@@ -75,6 +75,11 @@ type Indexer struct {
 	adler32 hash.Hash32
 	crc32   hash.Hash32
 	err     error
+
+	// OnBlock, if set, is called once per block as findBlock discovers
+	// it, letting callers drive a progress bar or per-block telemetry
+	// over a multi-GB lzop file.
+	OnBlock func(BlockInfo)
 }
 
 // NewReader creates a new Reader reading the given reader.
@@ -95,131 +100,21 @@ func (z *Indexer) read(data interface{}) error {
 }
 
 func (z *Indexer) readHeader() error {
-	// Read and check magic
-	if _, err := io.ReadFull(z.r, z.buf[0:len(lzoMagic)]); err != nil {
-		return err
-	}
-	if !bytes.Equal(z.buf[0:len(lzoMagic)], lzoMagic) {
-		return errors.New("lzo: invalid header")
-	}
-	z.crc32.Reset()
-	z.adler32.Reset()
-	// Read version
-	if err := z.read(&z.version); err != nil {
-		return err
-	}
-	if version < 0x0900 {
-		return errors.New("lzo: invalid header")
-	}
-	// Read library version needed to extract
-	if err := z.read(&z.libraryVersion); err != nil {
-		return err
-	}
-	if version >= 0x0940 {
-		if err := z.read(&z.libraryVersion); err != nil {
-			return err
-		}
-		if z.libraryVersion > z.version {
-			return errors.New("lzo: incompatible version")
-		}
-		if z.libraryVersion < 0x0900 {
-			return errors.New("lzo: invalid header")
-		}
-	}
-	// Read method
-	if err := z.read(&z.method); err != nil {
-		return err
-	}
-	// Read level
-	if version >= 0x0940 {
-		var level uint8
-		if err := z.read(&level); err != nil {
-			return err
-		}
-	}
-	// Read flags
-	if err := z.read(&z.flags); err != nil {
-		return err
-	}
-	// Read filters
-	if z.flags&flagFilter != 0 {
-		var filters uint32
-		if err := z.read(&filters); err != nil {
-			return err
-		}
-	}
-	// Read num_compressed_checksums
-	z.num_compressed_checksums = 0
-	if z.flags&flagAdler32C != 0 {
-		z.num_compressed_checksums += 1
-	}
-	if z.flags&flagCRC32C != 0 {
-		z.num_compressed_checksums += 1
-	}
-
-	// Read num_decompressed_checksums
-	z.num_decompressed_checksums = 0
-	if z.flags&flagAdler32D != 0 {
-		z.num_decompressed_checksums += 1
-	}
-	if z.flags&flagCRC32D != 0 {
-		z.num_decompressed_checksums += 1
-	}
-
-	// Read mode
-	var mode uint32
-	if err := z.read(&mode); err != nil {
-		return err
-	}
-	// Read modification times
-	var modTime, modTimeHigh uint32
-	if err := z.read(&modTime); err != nil {
-		return err
-	}
-	z.ModTime = time.Unix(int64(modTime), 0)
-	// Read mod time high
-	if version >= 0x0940 {
-		if err := z.read(&modTimeHigh); err != nil {
-			return err
-		}
-	}
-	if version < 0x0120 {
-		z.ModTime = time.Unix(0, 0)
-	}
-	// Read name
-	var l uint8
-	if err := z.read(&l); err != nil {
-		return err
-	}
-	if l > 0 {
-		if _, err := io.ReadFull(z.r, z.buf[0:l]); err != nil {
-			return err
-		}
-		z.Name = string(z.buf[0:l])
-	}
-	// Read and check header checksum
-	var checksum uint32
-	if z.flags&flagCRC32 != 0 {
-		checksum = z.crc32.Sum32()
-		z.crc32.Reset()
-	} else {
-		checksum = z.adler32.Sum32()
-		z.adler32.Reset()
-	}
-	var checksumHeader uint32
-	if err := z.read(&checksumHeader); err != nil {
+	hdr, err := readLzopHeader(z.r, z.adler32, z.crc32)
+	if err != nil {
 		return err
 	}
-	if checksumHeader != checksum {
-		return errors.New("lzo: invalid header")
-	}
-	if z.method <= 0 {
-		return errors.New("lzo: incompatible method")
-	}
+	z.IndexHeader = hdr
 	return nil
 }
 
 func (z *Indexer) findBlock() error {
+	block_start, err := z.f.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		z.err = err
+		return z.err
+	}
+
 	// Read uncompressed block size
 	var dstLen uint32
 	z.err = z.read(&dstLen)
@@ -241,58 +136,93 @@ func (z *Indexer) findBlock() error {
 		return z.err
 	}
 
-	num_chksms_to_skip := z.num_decompressed_checksums
-	if dstLen == srcLen {
-		num_chksms_to_skip += z.num_compressed_checksums
+	// Read the decompressed-data checksums, if any, so OnBlock can
+	// report them without a second pass over the file.
+	var adlerD, crcD uint32
+	if z.flags&flagAdler32D != 0 {
+		if z.err = z.read(&adlerD); z.err != nil {
+			return z.err
+		}
+	}
+	if z.flags&flagCRC32D != 0 {
+		if z.err = z.read(&crcD); z.err != nil {
+			return z.err
+		}
 	}
 
+	num_chksms_to_skip := uint(0)
+	if dstLen != srcLen {
+		num_chksms_to_skip = z.num_compressed_checksums
+	}
 	skip := 4 * num_chksms_to_skip
 
-	var position int64
-	position, z.err = z.f.Seek(0, os.SEEK_CUR)
-	if z.err != nil {
+	payload_start, err := z.f.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		z.err = err
 		return z.err
 	}
-	fmt.Println(position)
-	block_start := position - 8 // Rewind back to before the block headers
-	next_block := position + int64(srcLen) + int64(skip)
+	next_block := payload_start + int64(skip) + int64(srcLen)
+
 	z.indexes = append(z.indexes, block_start)
+	if z.OnBlock != nil {
+		z.OnBlock(BlockInfo{
+			Index:           len(z.indexes) - 1,
+			FileOffset:      block_start,
+			CompressedLen:   srcLen,
+			UncompressedLen: dstLen,
+			AdlerD:          adlerD,
+			CRCD:            crcD,
+		})
+	}
 	z.f.Seek(next_block, os.SEEK_SET)
 	return nil
 }
 
-func CreateIndex(filename string) error {
+// CreateIndex scans the lzop file at filename, writes its sidecar
+// <filename>.index in the Hadoop-compatible layout (see IndexWriter), and
+// returns the full per-block table, so callers that want both the
+// on-disk index and an in-memory one don't have to re-scan the file.
+func CreateIndex(filename string) ([]BlockInfo, error) {
 	index_file_name := filename + ".index"
 
 	lzofile, err := os.Open(filename)
 	defer lzofile.Close()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	indexfile, err := os.Create(index_file_name)
 	defer indexfile.Close()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	indexer, err := NewIndexer(lzofile)
+	if err != nil {
+		return nil, err
+	}
 	defer indexer.Close()
+
+	var blocks []BlockInfo
+	indexer.OnBlock = func(b BlockInfo) {
+		blocks = append(blocks, b)
+	}
 	for {
 		indexer.findBlock()
 		if indexer.err != nil {
 			break
 		}
 	}
-	if indexer.err == io.EOF {
-		for _, num := range indexer.indexes {
-			tmp := []byte{}
-			binary.BigEndian.PutUint64(tmp, uint64(num))
-			indexfile.Write(tmp)
+	if indexer.err != io.EOF {
+		return nil, indexer.err
+	}
+
+	iw := NewIndexWriter(indexfile)
+	for _, b := range blocks {
+		if err := iw.WriteBlockStart(b.FileOffset); err != nil {
+			return nil, err
 		}
-	} else {
-		return indexer.err
 	}
-	return nil
+	return blocks, nil
 }
 
 // Close closes the Reader. It does not close the underlying io.Reader.
@@ -0,0 +1,174 @@
+package lzo
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// registerStoreCodec registers a no-op "compressor" for MethodLZO1X1 so
+// tests can round-trip data through Writer and the various readers
+// without a real LZO1X implementation. Because it never shrinks its
+// input, every block ends up stored raw (srcLen == dstLen), which still
+// exercises the full block framing and checksum machinery.
+func registerStoreCodec() {
+	RegisterMethod(MethodLZO1X1,
+		func(src, dst []byte) (int, error) { return copy(dst, src), nil },
+		func(src, dst []byte, level int) (int, error) { return copy(dst, src), nil },
+	)
+}
+
+func writeTestLzop(t *testing.T, path string, data []byte, blockSize int) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := NewWriter(f)
+	w.blockSize = blockSize
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestWriterParallelReaderRoundTrip(t *testing.T) {
+	registerStoreCodec()
+	path := filepath.Join(t.TempDir(), "data.lzo")
+
+	data := make([]byte, 10*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+	writeTestLzop(t, path, data, 1024)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	pr, err := NewParallelReader(f)
+	if err != nil {
+		t.Fatalf("NewParallelReader: %v", err)
+	}
+
+	got, err := io.ReadAll(pr)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("round trip mismatch: got %d bytes, want %d", len(got), len(data))
+	}
+}
+
+func TestParallelReaderCloseStopsGoroutines(t *testing.T) {
+	registerStoreCodec()
+	path := filepath.Join(t.TempDir(), "data.lzo")
+
+	data := make([]byte, 200*1024)
+	rand.New(rand.NewSource(3)).Read(data)
+	writeTestLzop(t, path, data, 1024)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	pr, err := NewParallelReader(f)
+	if err != nil {
+		t.Fatalf("NewParallelReader: %v", err)
+	}
+
+	if _, err := pr.Read(make([]byte, 10)); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	before := runtime.NumGoroutine()
+	if err := pr.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() >= before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := runtime.NumGoroutine(); got >= before {
+		t.Fatalf("dispatcher/worker goroutines still running after Close: before=%d after=%d", before, got)
+	}
+}
+
+func TestOpenIndexedSeek(t *testing.T) {
+	registerStoreCodec()
+	path := filepath.Join(t.TempDir(), "data.lzo")
+
+	data := make([]byte, 10*1024)
+	rand.New(rand.NewSource(2)).Read(data)
+	writeTestLzop(t, path, data, 1024)
+
+	if _, err := CreateIndex(path); err != nil {
+		t.Fatalf("CreateIndex: %v", err)
+	}
+
+	r, err := OpenIndexed(path)
+	if err != nil {
+		t.Fatalf("OpenIndexed: %v", err)
+	}
+	defer r.Close()
+
+	if got, want := r.Len(), int64(len(data)); got != want {
+		t.Fatalf("Len() = %d, want %d", got, want)
+	}
+
+	const seekTo = 5000
+	if _, err := r.Seek(seekTo, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll after seek: %v", err)
+	}
+	if !bytes.Equal(got, data[seekTo:]) {
+		t.Fatalf("seek+read mismatch")
+	}
+}
+
+func TestSplitIterator(t *testing.T) {
+	idx := &Index{Starts: []int64{0, 500, 1500, 2600}, fileSize: 3000}
+
+	it, err := idx.SplitIterator(1000)
+	if err != nil {
+		t.Fatalf("SplitIterator: %v", err)
+	}
+
+	type span struct{ start, end int64 }
+	var got []span
+	for {
+		start, end, ok := it.Next()
+		if !ok {
+			break
+		}
+		got = append(got, span{start, end})
+	}
+	want := []span{{0, 1500}, {1500, 2600}, {2600, 3000}}
+	if len(got) != len(want) {
+		t.Fatalf("got %v splits, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("split %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if _, err := idx.SplitIterator(0); err == nil {
+		t.Fatal("expected error for non-positive splitSize")
+	}
+}
@@ -0,0 +1,399 @@
+package lzo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/adler32"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+// decoders maps an lzop method identifier to the function that decompresses
+// a single block payload compressed with that method. It starts out empty;
+// ParallelReader returns an error for any block whose method has not been
+// wired up by the caller.
+var decoders = map[uint8]func(src, dst []byte) (int, error){}
+
+const (
+	// defaultWorkers is the number of decompression goroutines a
+	// ParallelReader starts when SetConcurrency has not been called,
+	// mirroring pgzip's default.
+	defaultWorkers = 4
+	// defaultWindow is the buffer size of the job and result channels
+	// when SetConcurrency has not been called.
+	defaultWindow = 16
+)
+
+// block describes one lzop block as discovered while scanning the stream:
+// where its header begins in the underlying file, how large the payload is
+// on disk and once decompressed, and the checksums recorded for it.
+type block struct {
+	index      int
+	fileOffset int64 // offset of the dstLen field that opens the block
+	srcLen     uint32
+	dstLen     uint32
+	adlerD     uint32
+	hasAdlerD  bool
+	crcD       uint32
+	hasCRCD    bool
+}
+
+// decoded is the result a worker goroutine hands back for a block: either
+// the decompressed payload or the error that prevented producing one.
+type decoded struct {
+	index int
+	data  []byte
+	size  uint32 // pool key data was checked out under, for returning it later
+	err   error
+}
+
+// ParallelReader is a concurrent io.Reader for lzop streams, modeled on
+// pgzip's Reader: a fixed pool of decoder goroutines pull blocks off a
+// shared job channel, decompress and verify them independently, and an
+// ordering goroutine releases the results to Read callers in the order
+// they appear in the file regardless of which worker finished them first.
+type ParallelReader struct {
+	IndexHeader
+
+	f      *os.File
+	blocks []block
+	pos    int // index of the next block to hand to the dispatcher
+
+	workers int
+	window  int
+
+	bufPools sync.Map // dstLen (uint32) -> *sync.Pool of []byte
+
+	jobs      chan block
+	results   chan decoded
+	done      chan struct{}  // closed by Close to unblock the dispatcher and workers
+	workersWG sync.WaitGroup // lets Close wait for workers to stop touching bufPools
+	once      sync.Once
+	closed    sync.Once
+
+	pending map[int]decoded
+	want    int // index of the block Read is currently waiting on
+
+	// OnBlock, if set, is called once per block as a worker finishes
+	// decompressing and verifying it, for progress bars or per-block
+	// telemetry over multi-GB lzop files. Workers call it concurrently,
+	// in completion order rather than file order, so the callback itself
+	// must be safe for concurrent use (e.g. guard shared state with a
+	// mutex, or use atomic counters) - unlike Indexer.OnBlock, which is
+	// always called from a single synchronous scan.
+	OnBlock func(BlockInfo)
+
+	cur     []byte // bytes from the current block not yet returned to the caller
+	curBuf  []byte // full buffer backing cur, returned to the pool once cur is drained
+	curSize uint32 // pool key curBuf was checked out under
+	err     error
+}
+
+// NewParallelReader scans f for lzop block boundaries and returns a
+// ParallelReader ready to decompress it concurrently. f must support
+// seeking, since the scan walks the stream by jumping over each block's
+// compressed payload rather than reading it.
+func NewParallelReader(f *os.File) (*ParallelReader, error) {
+	z := &ParallelReader{
+		f:       f,
+		workers: defaultWorkers,
+		window:  defaultWindow,
+	}
+	adler, crc := adler32.New(), crc32.NewIEEE()
+	tee := io.TeeReader(f, io.MultiWriter(adler, crc))
+	hdr, err := readLzopHeader(tee, adler, crc)
+	if err != nil {
+		return nil, err
+	}
+	z.IndexHeader = hdr
+	if err := z.scanBlocks(); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// SetConcurrency sets the number of decoder goroutines (n) and the buffer
+// size of the job and result channels (blocks). Decoded blocks that Read
+// receives ahead of the one it is waiting for are held until consumed,
+// and their number is not capped by blocks. It must be called before the
+// first Read.
+func (z *ParallelReader) SetConcurrency(n, blocks int) error {
+	if n <= 0 || blocks <= 0 {
+		return errors.New("lzo: concurrency and block window must be positive")
+	}
+	z.workers = n
+	z.window = blocks
+	return nil
+}
+
+// scanBlocks walks the remainder of the stream recording each block's
+// position, lengths and decompressed-data checksums, the same way
+// Indexer.findBlock does, so workers can verify blocks without scanning
+// the file again.
+func (z *ParallelReader) scanBlocks() error {
+	idx := 0
+	for {
+		var dstLen uint32
+		if err := binary.Read(z.f, binary.BigEndian, &dstLen); err != nil {
+			return err
+		}
+		if dstLen == 0 {
+			return nil
+		}
+		var srcLen uint32
+		if err := binary.Read(z.f, binary.BigEndian, &srcLen); err != nil {
+			return err
+		}
+		if srcLen == 0 || srcLen > dstLen {
+			return errors.New("lzo: data corruption")
+		}
+
+		pos, err := z.f.Seek(0, os.SEEK_CUR)
+		if err != nil {
+			return err
+		}
+		b := block{
+			index:      idx,
+			fileOffset: pos - 8,
+			srcLen:     srcLen,
+			dstLen:     dstLen,
+		}
+		if z.num_decompressed_checksums > 0 {
+			if z.flags&flagAdler32D != 0 {
+				if err := binary.Read(z.f, binary.BigEndian, &b.adlerD); err != nil {
+					return err
+				}
+				b.hasAdlerD = true
+			}
+			if z.flags&flagCRC32D != 0 {
+				if err := binary.Read(z.f, binary.BigEndian, &b.crcD); err != nil {
+					return err
+				}
+				b.hasCRCD = true
+			}
+		}
+		if dstLen != srcLen && z.num_compressed_checksums > 0 {
+			if _, err := z.f.Seek(int64(4*z.num_compressed_checksums), os.SEEK_CUR); err != nil {
+				return err
+			}
+		}
+		if _, err := z.f.Seek(int64(srcLen), os.SEEK_CUR); err != nil {
+			return err
+		}
+		z.blocks = append(z.blocks, b)
+		idx++
+	}
+}
+
+// bufferFor returns a reusable []byte of length n from the pool keyed by n,
+// allocating a fresh pool the first time a given block size is seen. This
+// keeps allocations bounded when decompressing multi-gigabyte lzop files
+// made up of many same-sized blocks.
+func (z *ParallelReader) bufferFor(n uint32) []byte {
+	v, _ := z.bufPools.LoadOrStore(n, &sync.Pool{
+		New: func() interface{} { return make([]byte, n) },
+	})
+	return v.(*sync.Pool).Get().([]byte)
+}
+
+func (z *ParallelReader) putBuffer(n uint32, buf []byte) {
+	v, ok := z.bufPools.Load(n)
+	if !ok {
+		return
+	}
+	v.(*sync.Pool).Put(buf) //nolint:staticcheck // buf is exactly n bytes, safe to reuse
+}
+
+// start spins up the worker pool and the dispatcher/ordering goroutines the
+// first time Read is called.
+func (z *ParallelReader) start() {
+	z.jobs = make(chan block, z.window)
+	z.results = make(chan decoded, z.window)
+	z.done = make(chan struct{})
+	z.pending = make(map[int]decoded)
+
+	for i := 0; i < z.workers; i++ {
+		z.workersWG.Add(1)
+		go z.decodeWorker(&z.workersWG)
+	}
+	go func() {
+		defer close(z.jobs)
+		for _, b := range z.blocks {
+			select {
+			case z.jobs <- b:
+			case <-z.done:
+				return
+			}
+		}
+	}()
+	go func() {
+		z.workersWG.Wait()
+		close(z.results)
+	}()
+}
+
+// publish delivers d to z.results, unless Close has already signaled the
+// reader is being torn down, in which case it is dropped. Every send onto
+// z.results from a worker goroutine must go through this, or a caller that
+// stops draining Read (seek-away, early abort, error) would leave that
+// worker blocked forever on a full channel.
+func (z *ParallelReader) publish(d decoded) bool {
+	select {
+	case z.results <- d:
+		return true
+	case <-z.done:
+		return false
+	}
+}
+
+// decodeWorker pulls blocks off z.jobs, decompresses each one into a
+// pooled buffer and verifies its checksum before publishing the result,
+// exactly the way pgzip's decoder goroutines do.
+func (z *ParallelReader) decodeWorker(wg *sync.WaitGroup) {
+	defer wg.Done()
+	buf := make([]byte, 1<<20)
+	for b := range z.jobs {
+		if int(b.srcLen) > len(buf) {
+			buf = make([]byte, b.srcLen)
+		}
+		src := buf[:b.srcLen]
+		if _, err := z.f.ReadAt(src, b.fileOffset+8+int64(headerChecksumBytes(z, b))); err != nil {
+			if !z.publish(decoded{index: b.index, err: err}) {
+				return
+			}
+			continue
+		}
+		dst := z.bufferFor(b.dstLen)
+		dst = dst[:b.dstLen]
+		if b.dstLen == b.srcLen {
+			copy(dst, src)
+		} else {
+			dec, ok := decoders[z.method]
+			if !ok {
+				if !z.publish(decoded{index: b.index, err: fmt.Errorf("lzo: no decoder registered for method %d", z.method)}) {
+					return
+				}
+				continue
+			}
+			if _, err := dec(src, dst); err != nil {
+				if !z.publish(decoded{index: b.index, err: err}) {
+					return
+				}
+				continue
+			}
+		}
+		if err := verifyBlock(b, dst); err != nil {
+			if !z.publish(decoded{index: b.index, err: err}) {
+				return
+			}
+			continue
+		}
+		if err := applyFilter(z.IndexHeader, dst); err != nil {
+			if !z.publish(decoded{index: b.index, err: err}) {
+				return
+			}
+			continue
+		}
+		if z.OnBlock != nil {
+			z.OnBlock(BlockInfo{
+				Index:           b.index,
+				FileOffset:      b.fileOffset,
+				CompressedLen:   b.srcLen,
+				UncompressedLen: b.dstLen,
+				AdlerD:          b.adlerD,
+				CRCD:            b.crcD,
+			})
+		}
+		if !z.publish(decoded{index: b.index, data: dst, size: b.dstLen}) {
+			return
+		}
+	}
+}
+
+// headerChecksumBytes returns how many checksum bytes sit between a
+// block's srcLen field and its compressed payload, so workers can seek
+// straight to the payload when re-reading a block from disk.
+func headerChecksumBytes(z *ParallelReader, b block) int {
+	n := z.num_decompressed_checksums
+	if b.dstLen != b.srcLen {
+		n += z.num_compressed_checksums
+	}
+	return int(4 * n)
+}
+
+// verifyBlock recomputes the checksums recorded for a decompressed block
+// and confirms they match what the stream claimed.
+func verifyBlock(b block, data []byte) error {
+	if b.hasAdlerD {
+		if sum := adler32.Checksum(data); sum != b.adlerD {
+			return errors.New("lzo: adler32 checksum mismatch")
+		}
+	}
+	if b.hasCRCD {
+		if sum := crc32.ChecksumIEEE(data); sum != b.crcD {
+			return errors.New("lzo: crc32 checksum mismatch")
+		}
+	}
+	return nil
+}
+
+// Read implements io.Reader, returning decompressed bytes in file order.
+func (z *ParallelReader) Read(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	z.once.Do(z.start)
+
+	for len(z.cur) == 0 {
+		if z.curBuf != nil {
+			z.putBuffer(z.curSize, z.curBuf)
+			z.curBuf = nil
+		}
+		if z.want >= len(z.blocks) {
+			z.err = io.EOF
+			return 0, z.err
+		}
+		if r, ok := z.pending[z.want]; ok {
+			delete(z.pending, z.want)
+			if r.err != nil {
+				z.err = r.err
+				return 0, z.err
+			}
+			z.cur = r.data
+			z.curBuf = r.data
+			z.curSize = r.size
+			z.want++
+			continue
+		}
+		r, ok := <-z.results
+		if !ok {
+			z.err = errors.New("lzo: worker pool closed unexpectedly")
+			return 0, z.err
+		}
+		z.pending[r.index] = r
+	}
+
+	n := copy(p, z.cur)
+	z.cur = z.cur[n:]
+	return n, nil
+}
+
+// Close signals the dispatcher and worker goroutines to stop and releases
+// the ParallelReader's buffer pools. Without this, a caller that abandons
+// a ParallelReader before reading it to EOF (an early abort, an error, or
+// seeking away by opening a new reader) would leave every goroutine
+// started by start() permanently blocked on the bounded jobs/results
+// channels. It does not close the underlying *os.File.
+func (z *ParallelReader) Close() error {
+	z.closed.Do(func() {
+		if z.done != nil {
+			close(z.done)
+			z.workersWG.Wait()
+		}
+	})
+	z.bufPools = sync.Map{}
+	return nil
+}
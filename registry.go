@@ -0,0 +1,51 @@
+package lzo
+
+import "fmt"
+
+// Filter transforms a block's decompressed payload, mirroring lzop's
+// optional filters (flagFilter): Decode undoes the filter after
+// decompression, Encode applies it before compression.
+type Filter interface {
+	Decode(data []byte)
+	Encode(data []byte)
+}
+
+// filterRegistry holds the filters made available via RegisterFilter,
+// keyed by the lzop filter id readLzopHeader parses off flagFilter
+// streams.
+var filterRegistry = map[uint32]Filter{}
+
+// RegisterMethod makes an lzop compression method available to the
+// readers that decompress blocks (ParallelReader, IndexedReader) and to Writer,
+// mirroring archive/zip.RegisterCompressor. Either function may be nil if
+// only one direction is needed. This lets downstream users plug in a
+// cgo-backed liblzo2 or a pure-Go LZO1X implementation without forking
+// this package.
+func RegisterMethod(method uint8, dec func(src, dst []byte) (int, error), enc func(src, dst []byte, level int) (int, error)) {
+	if dec != nil {
+		decoders[method] = dec
+	}
+	if enc != nil {
+		encoders[method] = enc
+	}
+}
+
+// RegisterFilter makes filter available under id to every reader and to
+// Writer.
+func RegisterFilter(id uint32, filter Filter) {
+	filterRegistry[id] = filter
+}
+
+// applyFilter runs the filter a stream's header named, if any, over a
+// block's decompressed payload.
+func applyFilter(hdr IndexHeader, data []byte) error {
+	if !hdr.hasFilter {
+		return nil
+	}
+	f, ok := filterRegistry[hdr.filterID]
+	if !ok {
+		return fmt.Errorf("lzo: no filter registered for id %d", hdr.filterID)
+	}
+	f.Decode(data)
+	return nil
+}
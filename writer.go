@@ -0,0 +1,315 @@
+package lzo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/adler32"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// lzop compression methods, as named in the lzop format spec.
+const (
+	MethodLZO1X1    uint8 = 1
+	MethodLZO1X1_15 uint8 = 2
+	MethodLZO1X999  uint8 = 3
+)
+
+// defaultBlockSize is the uncompressed size a Writer accumulates before
+// emitting a block, matching lzop's own default (-b256).
+const defaultBlockSize = 256 * 1024
+
+// encoders maps an lzop method identifier to the function that compresses
+// a single block payload at the given level. It starts out empty; the
+// Write, Flush or Close call that emits a block returns an error for any
+// method that has not been wired up by the caller.
+var encoders = map[uint8]func(src, dst []byte, level int) (int, error){}
+
+// Header is the lzop metadata a Writer embeds in the stream, settable by
+// the caller before the first Write, mirroring compress/gzip.Header.
+type Header struct {
+	Name    string
+	ModTime time.Time
+	Method  uint8
+	Flags   uint32
+
+	// UseAdler32, UseCRC32 select which decompressed-block checksum(s)
+	// are written with every block (flagAdler32D / flagCRC32D). lzop
+	// enables Adler32 by default, so NewWriter does too.
+	UseAdler32 bool
+	UseCRC32   bool
+
+	// FilterID, if non-zero, names a filter registered via
+	// RegisterFilter to run over each block's payload (via Filter.Encode)
+	// before it is compressed; flagFilter and the id are written to the
+	// header so readers know to reverse it.
+	FilterID uint32
+}
+
+// Writer is an io.WriteCloser that writes an lzop-format compressed
+// stream, symmetrical to compress/gzip.Writer.
+type Writer struct {
+	Header
+
+	w       io.Writer
+	level   int
+	adler32 hash.Hash32
+	crc32   hash.Hash32
+
+	headerWritten bool
+	pending       []byte
+	blockSize     int
+
+	err error
+}
+
+// NewWriter creates a new Writer that writes lzop-compressed data to w
+// using BestSpeed-ish default compression. Callers must call Close to
+// flush the final block and the terminating zero-length block marker.
+func NewWriter(w io.Writer) *Writer {
+	zw, _ := NewWriterLevel(w, defaultCompression)
+	return zw
+}
+
+// NewWriterLevel is like NewWriter but lets the caller choose a
+// compression level, either BestSpeed, BestCompression, or
+// defaultCompression.
+func NewWriterLevel(w io.Writer, level int) (*Writer, error) {
+	if level != defaultCompression && (level < BestSpeed || level > BestCompression) {
+		return nil, fmt.Errorf("lzo: invalid compression level: %d", level)
+	}
+	return &Writer{
+		Header: Header{
+			Method:     MethodLZO1X1,
+			ModTime:    time.Now(),
+			UseAdler32: true,
+		},
+		w:         w,
+		level:     level,
+		blockSize: defaultBlockSize,
+		adler32:   adler32.New(),
+		crc32:     crc32.NewIEEE(),
+	}, nil
+}
+
+// writeHeader emits the lzop file header, hashing every byte written
+// after the magic the same way readLzopHeader verifies them on the way
+// back in - the magic itself is not part of the checksum.
+func (z *Writer) writeHeader() error {
+	z.headerWritten = true
+
+	if _, err := z.w.Write(lzoMagic); err != nil {
+		return err
+	}
+	z.adler32.Reset()
+	z.crc32.Reset()
+	mw := io.MultiWriter(z.w, z.adler32, z.crc32)
+
+	// lzop header layout from this point on matches readLzopHeader.
+	if err := binary.Write(mw, binary.BigEndian, uint16(version)); err != nil {
+		return err
+	}
+	if err := binary.Write(mw, binary.BigEndian, uint16(version)); err != nil {
+		return err
+	}
+	if version >= 0x0940 {
+		if err := binary.Write(mw, binary.BigEndian, uint16(version)); err != nil {
+			return err
+		}
+	}
+	if err := binary.Write(mw, binary.BigEndian, z.Method); err != nil {
+		return err
+	}
+	if version >= 0x0940 {
+		var level uint8
+		if z.level != defaultCompression {
+			level = uint8(z.level)
+		}
+		if err := binary.Write(mw, binary.BigEndian, level); err != nil {
+			return err
+		}
+	}
+
+	flags := z.Flags
+	if z.UseAdler32 {
+		flags |= flagAdler32D
+	}
+	if z.UseCRC32 {
+		flags |= flagCRC32D
+	}
+	if z.FilterID != 0 {
+		flags |= flagFilter
+	}
+	if err := binary.Write(mw, binary.BigEndian, flags); err != nil {
+		return err
+	}
+	if z.FilterID != 0 {
+		if err := binary.Write(mw, binary.BigEndian, z.FilterID); err != nil {
+			return err
+		}
+	}
+
+	if err := binary.Write(mw, binary.BigEndian, uint32(0)); err != nil { // mode
+		return err
+	}
+	if err := binary.Write(mw, binary.BigEndian, uint32(z.ModTime.Unix())); err != nil {
+		return err
+	}
+	if version >= 0x0940 {
+		if err := binary.Write(mw, binary.BigEndian, uint32(0)); err != nil { // mtime high
+			return err
+		}
+	}
+
+	if len(z.Name) > 255 {
+		return errors.New("lzo: name too long")
+	}
+	if err := binary.Write(mw, binary.BigEndian, uint8(len(z.Name))); err != nil {
+		return err
+	}
+	if len(z.Name) > 0 {
+		if _, err := mw.Write([]byte(z.Name)); err != nil {
+			return err
+		}
+	}
+
+	var checksum uint32
+	if flags&flagCRC32 != 0 {
+		checksum = z.crc32.Sum32()
+	} else {
+		checksum = z.adler32.Sum32()
+	}
+	return binary.Write(z.w, binary.BigEndian, checksum)
+}
+
+// Write buffers p, emitting one or more complete blocks as the buffer
+// fills past the configured block size.
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	if !z.headerWritten {
+		if err := z.writeHeader(); err != nil {
+			z.err = err
+			return 0, err
+		}
+	}
+	z.pending = append(z.pending, p...)
+	for len(z.pending) >= z.blockSize {
+		if err := z.writeBlock(z.pending[:z.blockSize]); err != nil {
+			z.err = err
+			return 0, err
+		}
+		z.pending = z.pending[z.blockSize:]
+	}
+	return len(p), nil
+}
+
+// Flush emits whatever is currently buffered as a single (possibly
+// undersized) block, without closing the stream. Further Writes start a
+// new block.
+func (z *Writer) Flush() error {
+	if z.err != nil {
+		return z.err
+	}
+	if !z.headerWritten {
+		if err := z.writeHeader(); err != nil {
+			z.err = err
+			return err
+		}
+	}
+	if len(z.pending) == 0 {
+		return nil
+	}
+	if err := z.writeBlock(z.pending); err != nil {
+		z.err = err
+		return err
+	}
+	z.pending = z.pending[:0]
+	return nil
+}
+
+// writeBlock compresses data with the registered encoder for z.Method,
+// falling back to storing it uncompressed when compression doesn't
+// shrink it, and emits the block header, checksums and payload.
+func (z *Writer) writeBlock(data []byte) error {
+	dstLen := uint32(len(data))
+
+	if z.FilterID != 0 {
+		f, ok := filterRegistry[z.FilterID]
+		if !ok {
+			return fmt.Errorf("lzo: no filter registered for id %d", z.FilterID)
+		}
+		f.Encode(data)
+	}
+
+	enc, ok := encoders[z.Method]
+	if !ok {
+		return fmt.Errorf("lzo: no encoder registered for method %d", z.Method)
+	}
+	// Room for LZO1X's worst-case expansion of incompressible input, so an
+	// encoder can report an expanded size and the block is stored instead.
+	buf := make([]byte, len(data)+len(data)/16+64+3)
+	n, err := enc(data, buf, z.level)
+	if err != nil {
+		return err
+	}
+
+	payload := buf[:n]
+	srcLen := uint32(n)
+	if srcLen >= dstLen {
+		payload = data
+		srcLen = dstLen
+	}
+
+	if err := binary.Write(z.w, binary.BigEndian, dstLen); err != nil {
+		return err
+	}
+	if err := binary.Write(z.w, binary.BigEndian, srcLen); err != nil {
+		return err
+	}
+	if z.UseAdler32 {
+		if err := binary.Write(z.w, binary.BigEndian, adler32.Checksum(data)); err != nil {
+			return err
+		}
+	}
+	if z.UseCRC32 {
+		if err := binary.Write(z.w, binary.BigEndian, crc32.ChecksumIEEE(data)); err != nil {
+			return err
+		}
+	}
+	_, err = z.w.Write(payload)
+	return err
+}
+
+// Close flushes any buffered data as a final block, writes the
+// terminating zero-length block marker, and prevents further writes. It
+// does not close the underlying io.Writer.
+func (z *Writer) Close() error {
+	if z.err != nil {
+		return z.err
+	}
+	if !z.headerWritten {
+		if err := z.writeHeader(); err != nil {
+			z.err = err
+			return err
+		}
+	}
+	if len(z.pending) > 0 {
+		if err := z.writeBlock(z.pending); err != nil {
+			z.err = err
+			return err
+		}
+		z.pending = nil
+	}
+	err := binary.Write(z.w, binary.BigEndian, uint32(0))
+	if err != nil {
+		z.err = err
+		return err
+	}
+	z.err = errors.New("lzo: Writer is closed")
+	return nil
+}